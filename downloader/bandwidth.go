@@ -0,0 +1,44 @@
+package downloader
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// bandwidthTracker measures a single worker's throughput so slow workers
+// can be identified and their remaining work stolen.
+type bandwidthTracker struct {
+	startedAt time.Time
+	bytes     int64
+}
+
+func newBandwidthTracker() *bandwidthTracker {
+	return &bandwidthTracker{startedAt: time.Now()}
+}
+
+func (t *bandwidthTracker) add(n int) {
+	atomic.AddInt64(&t.bytes, int64(n))
+}
+
+// bytesPerSec returns the worker's average throughput since the tracker
+// was created.
+func (t *bandwidthTracker) bytesPerSec() float64 {
+	elapsed := time.Since(t.startedAt).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&t.bytes)) / elapsed
+}
+
+// estimatedSecondsRemaining projects how long a worker with the given
+// throughput will take to finish remaining bytes. A worker with no
+// throughput sample yet (bytesPerSec <= 0, e.g. it only just started) is
+// treated as having an unknown-but-large ETA proportional to its remaining
+// bytes, so it can still be outranked by a demonstrably slow worker but
+// isn't mistaken for a fast one.
+func estimatedSecondsRemaining(remaining int64, bytesPerSec float64) float64 {
+	if bytesPerSec <= 0 {
+		return float64(remaining)
+	}
+	return float64(remaining) / bytesPerSec
+}
@@ -0,0 +1,391 @@
+// Package downloader implements a resumable, chunked HTTP file downloader.
+//
+// A Downloader splits a remote file into many small blocks, fetches them
+// concurrently with a work-stealing scheduler, and persists progress to a
+// sidecar manifest (<dest>.meta.json) so a Paused or interrupted download
+// can be Resumed later without re-fetching bytes that already landed on
+// disk.
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mujsann/file-downloader/verify"
+)
+
+const (
+	// MaxRetries is how many times a block request is retried on failure.
+	MaxRetries = 3
+
+	// flushInterval bounds how long a worker's progress can go unpersisted.
+	flushInterval = 2 * time.Second
+
+	// flushBytes bounds how many bytes a worker can write before its
+	// progress is flushed to the manifest, independent of flushInterval.
+	flushBytes = 1 << 20 // 1 MiB
+)
+
+// Status is the lifecycle state of a Downloader.
+type Status int
+
+const (
+	StatusReady Status = iota
+	StatusRunning
+	StatusPaused
+	StatusDone
+	StatusError
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusReady:
+		return "ready"
+	case StatusRunning:
+		return "running"
+	case StatusPaused:
+		return "paused"
+	case StatusDone:
+		return "done"
+	case StatusError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Downloader drives a single resumable download to completion.
+type Downloader struct {
+	url         string
+	mirrors     []string
+	destDir     string
+	client      *http.Client
+	concurrency int
+	blockSize   int64
+
+	checksum    string
+	checksumURL string
+	scanner     verify.Scanner
+	scanStrict  bool
+
+	mu       sync.Mutex
+	status   Status
+	dest     string
+	manifest *Manifest
+	cancel   context.CancelFunc
+}
+
+// New creates a Downloader for url that will write the finished file into
+// destDir, under a name derived from the server's response. Additional
+// byte-identical sources can be added with WithMirrors.
+func New(url, destDir string, opts ...Option) *Downloader {
+	d := &Downloader{
+		url:         url,
+		destDir:     destDir,
+		client:      http.DefaultClient,
+		status:      StatusReady,
+		concurrency: DefaultConcurrency,
+		blockSize:   DefaultBlockSize,
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Status returns the Downloader's current lifecycle state.
+func (d *Downloader) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// Dest returns the resolved destination file path. It is only meaningful
+// once Start has begun resolving the remote resource.
+func (d *Downloader) Dest() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dest
+}
+
+// Start begins a fresh download, or resumes one in place if a manifest
+// from a previous run is found next to dest and the remote resource still
+// matches it. It blocks until the download completes, fails, or ctx is
+// cancelled (e.g. via Pause).
+func (d *Downloader) Start(ctx context.Context) error {
+	if err := ensureDestDir(d.destDir); err != nil {
+		return fmt.Errorf("failed to prepare destination directory: %v", err)
+	}
+
+	res, err := Resolve(d.client, d.url)
+	if err != nil {
+		d.setStatus(StatusError)
+		return fmt.Errorf("failed to resolve resource: %v", err)
+	}
+	if !res.Rangeable {
+		fmt.Println("Server does not support byte ranges, falling back to a single-stream download")
+	}
+
+	pool := newMirrorPool(append([]string{d.url}, resolveMirrors(d.client, res, d.mirrors)...))
+
+	dest, err := destinationFor(d.destDir, res.Filename)
+	if err != nil {
+		d.setStatus(StatusError)
+		return err
+	}
+
+	manifest, fresh, err := d.loadOrCreateManifest(dest, res)
+	if err != nil {
+		d.setStatus(StatusError)
+		return err
+	}
+
+	d.mu.Lock()
+	d.dest = dest
+	d.manifest = manifest
+	d.status = StatusRunning
+	d.mu.Unlock()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	d.mu.Lock()
+	d.cancel = cancel
+	d.mu.Unlock()
+	defer cancel()
+
+	if manifest.Rangeable {
+		err = d.runBlocks(runCtx, manifest, fresh, pool)
+	} else {
+		err = d.runSingleStream(runCtx, manifest, res)
+	}
+
+	if err != nil {
+		if runCtx.Err() != nil {
+			// Cancelled via Pause, not a real failure.
+			d.setStatus(StatusPaused)
+			return nil
+		}
+		d.setStatus(StatusError)
+		return err
+	}
+
+	if err := d.verify(runCtx, manifest.Dest); err != nil {
+		d.setStatus(StatusError)
+		return err
+	}
+
+	if err := removeManifest(manifest.Dest); err != nil {
+		d.setStatus(StatusError)
+		return err
+	}
+
+	d.setStatus(StatusDone)
+	return nil
+}
+
+// verify runs the configured checksum and scan checks against the
+// completed download at dest, deleting it and returning an error if either
+// one fails the download.
+func (d *Downloader) verify(ctx context.Context, dest string) error {
+	if d.checksum != "" || d.checksumURL != "" {
+		want := d.checksum
+		if want == "" {
+			hash, err := verify.FetchChecksumFor(d.client, d.checksumURL, filepath.Base(dest))
+			if err != nil {
+				return fmt.Errorf("failed to fetch checksum: %v", err)
+			}
+			want = hash
+		}
+
+		if err := verify.VerifyChecksum(dest, want); err != nil {
+			os.Remove(dest)
+			return fmt.Errorf("checksum verification failed: %v", err)
+		}
+		fmt.Println("Checksum verified")
+	}
+
+	if d.scanner != nil {
+		result, err := d.scanner.Scan(ctx, dest)
+		if err != nil {
+			return fmt.Errorf("failed to scan downloaded file: %v", err)
+		}
+
+		if result.Clean {
+			fmt.Printf("Scan result: clean (%s)\n", result.Message)
+		} else {
+			fmt.Printf("Scan result: not clean (%s)\n", result.Message)
+			if d.scanStrict {
+				os.Remove(dest)
+				return fmt.Errorf("downloaded file failed scan: %s", result.Message)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Pause cancels all in-flight block requests but leaves the partial
+// destination file and the manifest in place, so a later Resume can pick
+// up where it left off.
+func (d *Downloader) Pause() {
+	d.mu.Lock()
+	cancel := d.cancel
+	d.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Resume continues a Paused download. It is equivalent to calling Start
+// again: the manifest on disk drives which blocks still need work.
+func (d *Downloader) Resume(ctx context.Context) error {
+	return d.Start(ctx)
+}
+
+func (d *Downloader) setStatus(s Status) {
+	d.mu.Lock()
+	d.status = s
+	d.mu.Unlock()
+}
+
+// loadOrCreateManifest returns the manifest to drive this run, resuming
+// the one on disk at dest when it still matches the resolved resource, or
+// starting a fresh one otherwise. The returned bool reports whether the
+// destination file needs to be (re)created from scratch.
+func (d *Downloader) loadOrCreateManifest(dest string, res *Resource) (*Manifest, bool, error) {
+	manifest, err := loadManifest(dest)
+	if err == nil && manifest.URL == d.url && manifest.TotalSize == res.Size && manifest.Rangeable == res.Rangeable &&
+		(res.Validator() == "" || manifestValidator(manifest) == res.Validator()) {
+		fmt.Printf("Resuming download of %s (%d bytes already on disk)\n", dest, manifest.downloadedBytes())
+		return manifest, false, nil
+	}
+
+	if err == nil {
+		// Manifest existed but no longer matches the remote resource.
+		fmt.Println("Resource changed since last attempt, restarting from scratch")
+	}
+
+	return freshManifest(d.url, dest, res, d.blockSize), true, nil
+}
+
+func manifestValidator(m *Manifest) string {
+	if m.ETag != "" {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+func (m *Manifest) downloadedBytes() int64 {
+	var total int64
+	for _, b := range m.Blocks {
+		total += b.Downloaded
+	}
+	return total
+}
+
+func freshManifest(url, dest string, res *Resource, blockSize int64) *Manifest {
+	var blocks []*Block
+
+	if !res.Rangeable {
+		// No Range support means no parallelism and no true resume: a
+		// single stream covers the whole body and any retry restarts it.
+		blocks = []*Block{{Start: 0, End: res.Size - 1}}
+	} else {
+		for start := int64(0); start < res.Size; start += blockSize {
+			end := start + blockSize - 1
+			if end > res.Size-1 {
+				end = res.Size - 1
+			}
+			blocks = append(blocks, &Block{Start: start, End: end})
+		}
+	}
+
+	return &Manifest{
+		URL:          url,
+		Dest:         dest,
+		TotalSize:    res.Size,
+		Rangeable:    res.Rangeable,
+		ETag:         res.ETag,
+		LastModified: res.LastModified,
+		BlockSize:    blockSize,
+		Blocks:       blocks,
+	}
+}
+
+// runBlocks downloads a rangeable resource's blocks with the work-stealing
+// scheduler, writing each block directly into dest at its offset. Blocks
+// are dispatched across pool, failing over to another mirror if one
+// fails.
+func (d *Downloader) runBlocks(ctx context.Context, manifest *Manifest, fresh bool, pool *mirrorPool) error {
+	file, err := os.OpenFile(manifest.Dest, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %v", err)
+	}
+	defer file.Close()
+
+	if fresh {
+		if err := file.Truncate(manifest.TotalSize); err != nil {
+			return fmt.Errorf("failed to pre-allocate output file: %v", err)
+		}
+	}
+
+	return newScheduler(d, manifest, file, pool).run(ctx)
+}
+
+// runSingleStream downloads a non-rangeable resource in one GET, streaming
+// the body straight into dest. res.Body, when set, is the still-open probe
+// response Resolve already fetched for this resource; reusing it avoids
+// issuing a second identical GET for the whole file.
+func (d *Downloader) runSingleStream(ctx context.Context, manifest *Manifest, res *Resource) error {
+	block := manifest.Blocks[0]
+
+	body := res.Body
+	if body == nil {
+		req, err := http.NewRequestWithContext(ctx, "GET", d.url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create GET request: %v", err)
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to perform GET request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("server returned status: %s", resp.Status)
+		}
+		body = resp.Body
+	} else {
+		defer body.Close()
+	}
+
+	file, err := os.Create(manifest.Dest)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, body)
+	block.Downloaded = n
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+
+	return nil
+}
+
+// flush persists the manifest's current progress to disk.
+func (d *Downloader) flush(manifest *Manifest) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return manifest.save()
+}
@@ -0,0 +1,220 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pausableRangeServer behaves like rangeServer, but every real block
+// request (not the bytes=0-0 probe Resolve issues) sleeps while slow is
+// true, so a test can hold a download open long enough to Pause it and
+// then let a second Start sail through to completion.
+func pausableRangeServer(t *testing.T, body []byte, etag string, slow *atomic.Bool) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end > int64(len(body))-1 {
+			end = int64(len(body)) - 1
+		}
+		if !(start == 0 && end == 0) && slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[start : end+1])
+	}))
+}
+
+func TestDownloaderResumesAcrossRestartAfterPause(t *testing.T) {
+	body := make([]byte, 4*1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate random body: %v", err)
+	}
+
+	var slow atomic.Bool
+	slow.Store(true)
+	srv := pausableRangeServer(t, body, "", &slow)
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	d1 := New(srv.URL, dir, WithConcurrency(2), WithBlockSize(1<<20))
+	done := make(chan error, 1)
+	go func() { done <- d1.Start(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	d1.Pause()
+
+	if err := <-done; err != nil {
+		t.Fatalf("first Start should report a clean pause, not an error: %v", err)
+	}
+	if d1.Status() != StatusPaused {
+		t.Fatalf("got status %s, want %s", d1.Status(), StatusPaused)
+	}
+
+	partial, err := os.ReadFile(d1.Dest())
+	if err != nil {
+		t.Fatalf("failed to read partial file: %v", err)
+	}
+	if bytes.Equal(partial, body) {
+		t.Fatal("expected the paused download to be incomplete before resuming")
+	}
+	if _, err := os.Stat(d1.Dest() + ".meta.json"); err != nil {
+		t.Fatalf("expected a manifest to survive the pause: %v", err)
+	}
+
+	// Simulate a second invocation against the same dest: a brand new
+	// Downloader, same url/destDir, nothing carried over in memory.
+	slow.Store(false)
+	d2 := New(srv.URL, dir, WithConcurrency(2), WithBlockSize(1<<20))
+	if err := d2.Start(context.Background()); err != nil {
+		t.Fatalf("resumed Start failed: %v", err)
+	}
+	if d2.Status() != StatusDone {
+		t.Fatalf("got status %s, want %s", d2.Status(), StatusDone)
+	}
+
+	got, err := os.ReadFile(d2.Dest())
+	if err != nil {
+		t.Fatalf("failed to read resumed file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("resumed download does not match the source body")
+	}
+	if _, err := os.Stat(d2.Dest() + ".meta.json"); !os.IsNotExist(err) {
+		t.Fatal("expected the manifest to be cleaned up after the resumed download completes")
+	}
+}
+
+func TestDownloaderDiscardsStateWhenETagChanges(t *testing.T) {
+	body := make([]byte, 2*1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate random body: %v", err)
+	}
+
+	var slow atomic.Bool
+	slow.Store(true)
+	etag := atomicString{}
+	etag.Store(`"v1"`)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end > int64(len(body))-1 {
+			end = int64(len(body)) - 1
+		}
+		if !(start == 0 && end == 0) && slow.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("ETag", etag.Load())
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[start : end+1])
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	d1 := New(srv.URL, dir, WithConcurrency(2), WithBlockSize(1<<20))
+	done := make(chan error, 1)
+	go func() { done <- d1.Start(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	d1.Pause()
+	if err := <-done; err != nil {
+		t.Fatalf("first Start should report a clean pause, not an error: %v", err)
+	}
+
+	manifestBefore, err := loadManifest(d1.Dest())
+	if err != nil {
+		t.Fatalf("expected a manifest after pausing: %v", err)
+	}
+	if manifestBefore.ETag != `"v1"` {
+		t.Fatalf("got manifest ETag %q, want %q", manifestBefore.ETag, `"v1"`)
+	}
+
+	// The resource changed underneath the paused download.
+	etag.Store(`"v2"`)
+	slow.Store(false)
+
+	d2 := New(srv.URL, dir, WithConcurrency(2), WithBlockSize(1<<20))
+	if err := d2.Start(context.Background()); err != nil {
+		t.Fatalf("restart after an ETag change failed: %v", err)
+	}
+	if d2.Status() != StatusDone {
+		t.Fatalf("got status %s, want %s", d2.Status(), StatusDone)
+	}
+
+	got, err := os.ReadFile(d2.Dest())
+	if err != nil {
+		t.Fatalf("failed to read the restarted file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("restarted download does not match the current source body")
+	}
+}
+
+func TestDownloaderSingleStreamReusesProbeRequest(t *testing.T) {
+	body := []byte("non-rangeable body")
+	var requests int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		// Ignore Range entirely and don't advertise support for it either.
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir)
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if got := atomic.LoadInt64(&requests); got != 1 {
+		t.Fatalf("got %d requests, want exactly 1 (probe body should be reused instead of re-fetched)", got)
+	}
+
+	got, err := os.ReadFile(d.Dest())
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("downloaded file does not match source body")
+	}
+}
+
+// atomicString is a tiny helper so the ETag test server can swap its ETag
+// header safely across goroutines without reaching for sync/atomic.Value's
+// interface{} ceremony for a single string field.
+type atomicString struct {
+	v atomic.Value
+}
+
+func (s *atomicString) Store(v string) { s.v.Store(v) }
+func (s *atomicString) Load() string {
+	v, _ := s.v.Load().(string)
+	return v
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// Block is a byte range claimed by a single worker and written directly
+// into the destination file at Start via os.File.WriteAt. End is mutated
+// with atomic.CompareAndSwapInt64 when an idle worker steals the unwritten
+// tail of a slow block, so it must only be read/written through the
+// sync/atomic package.
+type Block struct {
+	Start      int64 `json:"start"`
+	End        int64 `json:"end"`
+	Downloaded int64 `json:"downloaded"`
+}
+
+// done reports whether the block has received every byte up to its
+// current (possibly shrunk) end offset.
+func (b *Block) done() bool {
+	return atomic.LoadInt64(&b.Downloaded) >= (atomic.LoadInt64(&b.End)-b.Start)+1
+}
+
+// remaining returns how many bytes are left to fetch for this block.
+func (b *Block) remaining() int64 {
+	return (atomic.LoadInt64(&b.End) - b.Start + 1) - atomic.LoadInt64(&b.Downloaded)
+}
+
+// Manifest is the sidecar file persisted alongside a partial download so a
+// later process can verify the remote resource hasn't changed and resume
+// only the blocks that are still incomplete.
+type Manifest struct {
+	URL          string   `json:"url"`
+	Dest         string   `json:"dest"`
+	TotalSize    int64    `json:"total_size"`
+	Rangeable    bool     `json:"rangeable"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	BlockSize    int64    `json:"block_size"`
+	Blocks       []*Block `json:"blocks"`
+}
+
+// manifestPath returns the sidecar path for a given destination file, e.g.
+// "movie.mp4" -> "movie.mp4.meta.json".
+func manifestPath(dest string) string {
+	return dest + ".meta.json"
+}
+
+// loadManifest reads and parses the sidecar manifest for dest, if any.
+func loadManifest(dest string) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath(dest))
+	if err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	return &m, nil
+}
+
+// save writes the manifest to its sidecar path atomically by writing to a
+// temp file in the same directory and renaming over the destination, so a
+// crash mid-write never leaves a corrupt manifest behind.
+func (m *Manifest) save() error {
+	// Blocks are mutated via atomic.CompareAndSwapInt64 concurrently with
+	// saves; snapshot them through the same path so json.Marshal never
+	// races with a worker's plain field read.
+	snapshot := make([]*Block, len(m.Blocks))
+	for i, b := range m.Blocks {
+		snapshot[i] = &Block{
+			Start:      b.Start,
+			End:        atomic.LoadInt64(&b.End),
+			Downloaded: atomic.LoadInt64(&b.Downloaded),
+		}
+	}
+
+	data, err := json.Marshal(&Manifest{
+		URL:          m.URL,
+		Dest:         m.Dest,
+		TotalSize:    m.TotalSize,
+		Rangeable:    m.Rangeable,
+		ETag:         m.ETag,
+		LastModified: m.LastModified,
+		BlockSize:    m.BlockSize,
+		Blocks:       snapshot,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+
+	path := manifestPath(m.Dest)
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest temp file: %v", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to rename manifest into place: %v", err)
+	}
+
+	return nil
+}
+
+// removeManifest deletes the sidecar manifest for dest, if present.
+func removeManifest(dest string) error {
+	err := os.Remove(manifestPath(dest))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ensureDestDir makes sure the directory that will hold dest exists.
+func ensureDestDir(dest string) error {
+	dir := filepath.Dir(dest)
+	if dir == "" || dir == "." {
+		return nil
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// destinationFor joins filename onto destDir and confirms the result
+// didn't escape destDir. filename is expected to already be sanitized (see
+// sanitizeFilename), so this exists only as a defense-in-depth check
+// against a future bug there rather than the primary guard.
+func destinationFor(destDir, filename string) (string, error) {
+	dest := filepath.Join(destDir, filename)
+
+	rel, err := filepath.Rel(destDir, dest)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("resolved filename %q escapes destination directory %q", filename, destDir)
+	}
+
+	return dest, nil
+}
@@ -0,0 +1,34 @@
+package downloader
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDestinationForRejectsEscapingFilenames(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := destinationFor(dir, "report.pdf"); err != nil {
+		t.Fatalf("expected a plain filename to be accepted, got: %v", err)
+	}
+
+	// sanitizeFilename should already strip these before they ever reach
+	// destinationFor; this exercises the guard on its own as a backstop.
+	for _, name := range []string{"../escaped", "..", "../../etc/passwd"} {
+		if _, err := destinationFor(dir, name); err == nil {
+			t.Fatalf("expected destinationFor(%q, %q) to reject an escaping filename", dir, name)
+		}
+	}
+}
+
+func TestDestinationForJoinsUnderDestDir(t *testing.T) {
+	dir := t.TempDir()
+
+	dest, err := destinationFor(dir, "archive.zip")
+	if err != nil {
+		t.Fatalf("destinationFor failed: %v", err)
+	}
+	if dest != filepath.Join(dir, "archive.zip") {
+		t.Fatalf("got %q, want %q", dest, filepath.Join(dir, "archive.zip"))
+	}
+}
@@ -0,0 +1,133 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ewmaAlpha weights how quickly a mirror's throughput estimate reacts to a
+// new sample versus its history.
+const ewmaAlpha = 0.3
+
+// mirror tracks one candidate source for the resource and an exponentially
+// weighted moving average of its observed throughput, so the scheduler can
+// keep sending requests to whichever source is currently fastest.
+type mirror struct {
+	url string
+
+	mu   sync.Mutex
+	ewma float64 // bytes/sec
+}
+
+// recordSuccess folds a completed request's throughput into the mirror's
+// EWMA.
+func (m *mirror) recordSuccess(bytesPerSec float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ewma = ewmaAlpha*bytesPerSec + (1-ewmaAlpha)*m.ewma
+}
+
+// recordFailure halves the mirror's estimate so a failing source quickly
+// falls out of favor without being written off after one bad request.
+func (m *mirror) recordFailure() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ewma /= 2
+}
+
+func (m *mirror) throughput() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ewma
+}
+
+// mirrorPool is the set of sources a scheduler may dispatch block requests
+// to.
+type mirrorPool struct {
+	mirrors []*mirror
+	next    uint64 // round-robin cursor used to split ties
+}
+
+func newMirrorPool(urls []string) *mirrorPool {
+	pool := &mirrorPool{mirrors: make([]*mirror, len(urls))}
+	for i, u := range urls {
+		// Start every mirror with an optimistic, equal estimate so the
+		// first request to each one isn't biased by an arbitrary order.
+		pool.mirrors[i] = &mirror{url: u, ewma: 1}
+	}
+	return pool
+}
+
+// pick returns the mirror with the best current throughput estimate,
+// excluding any mirror in avoid (typically ones that just failed within
+// the same fetch attempt). Mirrors tied for best - notably every mirror,
+// before any of them has completed a request - are split round-robin so
+// an untested mirror actually gets a turn instead of the first one in the
+// list winning every tie forever.
+func (p *mirrorPool) pick(avoid *mirror) *mirror {
+	var candidates []*mirror
+	var bestThroughput float64
+
+	for _, m := range p.mirrors {
+		if m == avoid {
+			continue
+		}
+		t := m.throughput()
+		switch {
+		case len(candidates) == 0 || t > bestThroughput:
+			bestThroughput = t
+			candidates = []*mirror{m}
+		case t == bestThroughput:
+			candidates = append(candidates, m)
+		}
+	}
+
+	if len(candidates) == 0 {
+		// Every mirror is in avoid; there's nothing else to try.
+		return avoid
+	}
+
+	idx := atomic.AddUint64(&p.next, 1) - 1
+	return candidates[idx%uint64(len(candidates))]
+}
+
+// resolveMirrors resolves every additional mirror URL and keeps only the
+// ones whose size, range support, and validator (when both sides have one)
+// agree with primary. Mismatched or unreachable mirrors are dropped with a
+// logged reason rather than silently served, since a mismatch there means
+// the user could otherwise get bytes from two different files stitched
+// together.
+func resolveMirrors(client *http.Client, primary *Resource, mirrorURLs []string) []string {
+	agreeing := make([]string, 0, len(mirrorURLs))
+
+	for _, u := range mirrorURLs {
+		res, err := Resolve(client, u)
+		if err != nil {
+			fmt.Printf("mirror %s: rejected, failed to resolve: %v\n", u, err)
+			continue
+		}
+		if res.Body != nil {
+			// Mirror resolution only compares metadata; nothing here
+			// consumes the probe body.
+			res.Body.Close()
+		}
+		if res.Size != primary.Size {
+			fmt.Printf("mirror %s: rejected, size %d does not match primary size %d\n", u, res.Size, primary.Size)
+			continue
+		}
+		if res.Rangeable != primary.Rangeable {
+			fmt.Printf("mirror %s: rejected, range support does not match primary\n", u)
+			continue
+		}
+		if primary.Validator() != "" && res.Validator() != "" && primary.Validator() != res.Validator() {
+			fmt.Printf("mirror %s: rejected, validator %q does not match primary %q\n", u, res.Validator(), primary.Validator())
+			continue
+		}
+
+		agreeing = append(agreeing, u)
+	}
+
+	return agreeing
+}
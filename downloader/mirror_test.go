@@ -0,0 +1,80 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDownloaderFailsOverToWorkingMirror(t *testing.T) {
+	body := make([]byte, 4*1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate random body: %v", err)
+	}
+	size := int64(len(body))
+
+	// bad answers the initial Resolve probe honestly (so it's accepted
+	// into the mirror pool) but fails every real block request, so the
+	// scheduler has to fail over to good partway through.
+	var badBlockHits int64
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-0" {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-0/%d", size))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(body[:1])
+			return
+		}
+		atomic.AddInt64(&badBlockHits, 1)
+		http.Error(w, "gone", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	good := rangeServer(t, body, nil)
+	defer good.Close()
+
+	dir := t.TempDir()
+	d := New(good.URL, dir, WithConcurrency(4), WithBlockSize(1<<20), WithMirrors(bad.URL))
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	if atomic.LoadInt64(&badBlockHits) == 0 {
+		t.Fatal("expected the failing mirror to be tried for at least one block")
+	}
+
+	got, err := os.ReadFile(d.Dest())
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("downloaded file does not match source body")
+	}
+}
+
+func TestResolveMirrorsRejectsSizeMismatch(t *testing.T) {
+	primary := rangeServer(t, make([]byte, 1024), nil)
+	defer primary.Close()
+
+	mismatched := rangeServer(t, make([]byte, 2048), nil)
+	defer mismatched.Close()
+
+	primaryRes, err := Resolve(http.DefaultClient, primary.URL)
+	if err != nil {
+		t.Fatalf("failed to resolve primary: %v", err)
+	}
+	if primaryRes.Body != nil {
+		defer primaryRes.Body.Close()
+	}
+
+	agreeing := resolveMirrors(http.DefaultClient, primaryRes, []string{mismatched.URL})
+	if len(agreeing) != 0 {
+		t.Fatalf("expected size-mismatched mirror to be rejected, got %v", agreeing)
+	}
+}
@@ -0,0 +1,76 @@
+package downloader
+
+import "github.com/mujsann/file-downloader/verify"
+
+const (
+	// DefaultConcurrency is how many blocks are fetched in parallel when
+	// the caller doesn't specify a concurrency via WithConcurrency.
+	DefaultConcurrency = 4
+
+	// DefaultBlockSize is the size of each block the scheduler splits a
+	// rangeable resource into, absent a WithBlockSize override.
+	DefaultBlockSize = 2 << 20 // 2 MiB
+)
+
+// Option configures a Downloader created with New.
+type Option func(*Downloader)
+
+// WithConcurrency sets how many blocks are fetched in parallel. Values
+// less than 1 are ignored.
+func WithConcurrency(n int) Option {
+	return func(d *Downloader) {
+		if n > 0 {
+			d.concurrency = n
+		}
+	}
+}
+
+// WithBlockSize sets the size, in bytes, of each block the scheduler
+// splits a rangeable resource into. Values less than 1 are ignored.
+func WithBlockSize(bytes int64) Option {
+	return func(d *Downloader) {
+		if bytes > 0 {
+			d.blockSize = bytes
+		}
+	}
+}
+
+// WithMirrors adds additional byte-identical sources for the resource.
+// Each one is resolved and cross-checked against the primary URL before
+// the download starts; any that don't match are dropped with a logged
+// reason instead of being used. Blocks are dispatched to whichever mirror
+// currently has the best observed throughput, and a block that fails on
+// one mirror is retried on another rather than failing the download.
+func WithMirrors(urls ...string) Option {
+	return func(d *Downloader) {
+		d.mirrors = append(d.mirrors, urls...)
+	}
+}
+
+// WithChecksum verifies the completed download against a known sha256
+// digest (hex-encoded), deleting the file and failing the download on
+// mismatch.
+func WithChecksum(sha256Hex string) Option {
+	return func(d *Downloader) {
+		d.checksum = sha256Hex
+	}
+}
+
+// WithChecksumURL verifies the completed download against a digest fetched
+// from a `sha256sum`-format file at checksumURL. Ignored if WithChecksum is
+// also set.
+func WithChecksumURL(checksumURL string) Option {
+	return func(d *Downloader) {
+		d.checksumURL = checksumURL
+	}
+}
+
+// WithScanner runs scanner against the completed download and logs its
+// verdict. If strict is true, a non-clean verdict deletes the file and
+// fails the download instead of merely being logged.
+func WithScanner(scanner verify.Scanner, strict bool) Option {
+	return func(d *Downloader) {
+		d.scanner = scanner
+		d.scanStrict = strict
+	}
+}
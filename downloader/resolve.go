@@ -0,0 +1,217 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxFilenameLength caps a sanitized filename at the lowest common
+// filesystem name limit (ext4/NTFS/APFS all allow 255 bytes).
+const maxFilenameLength = 255
+
+// Resource describes what Resolve learned about a remote file: how big it
+// is, whether it supports byte-range requests, and how to name it once it
+// lands on disk.
+type Resource struct {
+	Size         int64
+	Rangeable    bool
+	ETag         string
+	LastModified string
+	Filename     string
+
+	// Body is the still-open probe response body, set only when
+	// Rangeable is false. In that case the probe GET already pulled down
+	// the entire body (the server ignored the Range header), so the
+	// caller should consume this directly instead of issuing a second GET
+	// for the same bytes, and must close it when done.
+	Body io.ReadCloser
+}
+
+// Validator returns the value used to detect that the remote resource has
+// changed between a paused download and its resume. Prefer ETag, since
+// Last-Modified alone can't distinguish byte-identical-looking edits.
+func (r *Resource) Validator() string {
+	if r.ETag != "" {
+		return r.ETag
+	}
+	return r.LastModified
+}
+
+var contentRangeTotalRe = regexp.MustCompile(`^bytes \d+-\d+/(\d+)$`)
+
+// Resolve probes url with a `Range: bytes=0-0` request instead of a HEAD,
+// since some servers only advertise range support (and sometimes only
+// report their true size) on a GET. A 206 response with a parsable
+// Content-Range total confirms range support and size. A 200 response
+// means the server ignored the Range header; it's treated as
+// non-rangeable unless it advertises `Accept-Ranges: bytes` anyway, in
+// which case we trust that signal over the single probe response.
+func Resolve(client *http.Client, url string) (*Resource, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create probe request: %v", err)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform probe request: %v", err)
+	}
+
+	cd := resp.Header.Get("Content-Disposition")
+	if cd == "" {
+		log.Printf("Content-Disposition header is missing")
+	}
+
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" {
+		log.Printf("Content-Type header is missing")
+	}
+
+	name := getFileName(cd, url)
+	if ext := detectFileType(ct); ext != "" && !strings.EqualFold(filepath.Ext(name), ext) {
+		name = truncateToFilesystemLimit(name+ext, ext)
+	}
+
+	res := &Resource{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Filename:     name,
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// The probe body is just the single byte we asked for; nothing in
+		// it is useful to the caller.
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		cr := resp.Header.Get("Content-Range")
+		m := contentRangeTotalRe.FindStringSubmatch(cr)
+		if m == nil {
+			return nil, fmt.Errorf("server returned 206 with unparsable Content-Range: %q", cr)
+		}
+		size, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Content-Range total: %v", err)
+		}
+		res.Size = size
+		res.Rangeable = true
+
+	case http.StatusOK:
+		res.Rangeable = resp.Header.Get("Accept-Ranges") == "bytes"
+
+		size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("server ignored Range probe and reported no usable Content-Length: %v", err)
+		}
+		res.Size = size
+
+		if res.Rangeable {
+			// Accept-Ranges says the server does support ranges even
+			// though it ignored this probe; the scheduler will fetch
+			// what it needs itself, so this body goes unused.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			// No range support: this probe GET already pulled down the
+			// entire body, since the server ignored our Range header.
+			// Hand it to the caller so runSingleStream can consume it
+			// directly instead of fetching the same bytes again.
+			res.Body = resp.Body
+		}
+
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned non-200/206 status to probe request: %s", resp.Status)
+	}
+
+	return res, nil
+}
+
+func detectFileType(contentType string) string {
+	// clean the Content-Type in case of e.g Content-Type: text/html; charset=UTF-8
+	contentType = strings.Split(contentType, ";")[0]
+
+	extensions, err := mime.ExtensionsByType(contentType)
+	if err != nil {
+		log.Printf("error getting extensions for Content-Type '%s': %v", contentType, err)
+		return ""
+	}
+
+	if len(extensions) > 0 {
+		return extensions[0]
+	}
+
+	log.Printf("failed to find extensions for Content-Type '%s'", contentType)
+	return ""
+}
+
+// getFileName picks a safe file name from content-disposition, else the
+// URL, else a random name if neither yields anything usable once
+// sanitized. mime.ParseMediaType already decodes RFC 5987 extended
+// parameters (filename*=UTF-8”...) into the same "filename" key as the
+// plain form.
+func getFileName(contentDisposition, url string) string {
+	if contentDisposition != "" {
+		if _, params, err := mime.ParseMediaType(contentDisposition); err == nil {
+			if name := sanitizeFilename(params["filename"]); name != "" {
+				return name
+			}
+		}
+	}
+
+	if name := sanitizeFilename(path.Base(url)); name != "" {
+		return name
+	}
+
+	return "random" + strconv.Itoa(int(rand.Int64()))
+}
+
+// sanitizeFilename strips anything in name that would let a hostile
+// Content-Disposition header or URL path escape the destination directory
+// or corrupt the filesystem: directory separators (and ".." components
+// they'd otherwise hide), control characters, and names longer than the
+// filesystem allows. It returns "" if nothing usable is left.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	// Treat backslashes as separators too, since a server on any OS can
+	// send Windows-style paths, and take the last element so any ".."
+	// components are discarded rather than walked.
+	name = filepath.Base(filepath.Clean(strings.ReplaceAll(name, "\\", "/")))
+
+	switch name {
+	case ".", "..", string(filepath.Separator), "":
+		return ""
+	}
+
+	return truncateToFilesystemLimit(name, filepath.Ext(name))
+}
+
+// truncateToFilesystemLimit shortens name to maxFilenameLength bytes,
+// preserving ext (the suffix to keep intact) rather than cutting into it.
+func truncateToFilesystemLimit(name, ext string) string {
+	if len(name) <= maxFilenameLength {
+		return name
+	}
+	if len(ext) > maxFilenameLength {
+		ext = ext[:maxFilenameLength]
+	}
+	return name[:maxFilenameLength-len(ext)] + ext
+}
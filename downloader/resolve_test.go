@@ -0,0 +1,146 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetFileNameSanitizesAdversarialContentDisposition(t *testing.T) {
+	tests := []struct {
+		name               string
+		contentDisposition string
+		url                string
+		want               string
+	}{
+		{
+			name:               "plain filename",
+			contentDisposition: `attachment; filename="report.pdf"`,
+			url:                "https://example.com/x",
+			want:               "report.pdf",
+		},
+		{
+			name:               "rfc 5987 extended filename",
+			contentDisposition: `attachment; filename*=UTF-8''report%20final.pdf`,
+			url:                "https://example.com/x",
+			want:               "report final.pdf",
+		},
+		{
+			name:               "path traversal via relative dots",
+			contentDisposition: `attachment; filename="../../etc/passwd"`,
+			url:                "https://example.com/x",
+			want:               "passwd",
+		},
+		{
+			name:               "absolute unix path",
+			contentDisposition: `attachment; filename="/etc/cron.d/evil"`,
+			url:                "https://example.com/x",
+			want:               "evil",
+		},
+		{
+			name:               "windows-style path",
+			contentDisposition: `attachment; filename="..\\..\\Windows\\System32\\evil.exe"`,
+			url:                "https://example.com/x",
+			want:               "evil.exe",
+		},
+		{
+			name:               "bare dot-dot falls through to url",
+			contentDisposition: `attachment; filename=".."`,
+			url:                "https://example.com/report.pdf",
+			want:               "report.pdf",
+		},
+		{
+			name:               "null byte and control characters stripped",
+			contentDisposition: "attachment; filename=\"evil\x00.pdf.exe\"",
+			url:                "https://example.com/x",
+			want:               "evil.pdf.exe",
+		},
+		{
+			name:               "missing content-disposition falls back to url",
+			contentDisposition: "",
+			url:                "https://example.com/path/to/archive.zip",
+			want:               "archive.zip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getFileName(tt.contentDisposition, tt.url)
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFileNameFallsBackToRandomWhenNothingUsableRemains(t *testing.T) {
+	got := getFileName("", "")
+	if !strings.HasPrefix(got, "random") {
+		t.Fatalf("expected a random fallback name, got %q", got)
+	}
+}
+
+func TestSanitizeFilenameTruncatesOverlongNames(t *testing.T) {
+	name := strings.Repeat("a", 300) + ".txt"
+	got := sanitizeFilename(name)
+
+	if len(got) > maxFilenameLength {
+		t.Fatalf("sanitized name is %d bytes, want at most %d", len(got), maxFilenameLength)
+	}
+	if !strings.HasSuffix(got, ".txt") {
+		t.Fatalf("expected truncation to preserve the extension, got %q", got)
+	}
+}
+
+func TestResolveDoesNotDuplicateMatchingExtension(t *testing.T) {
+	body := []byte("pdf body")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	res, err := Resolve(http.DefaultClient, srv.URL)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if res.Filename != "report.pdf" {
+		t.Fatalf("got filename %q, want %q (extension should not be duplicated)", res.Filename, "report.pdf")
+	}
+}
+
+func TestResolveKeepsAppendedExtensionWithinFilesystemLimit(t *testing.T) {
+	body := []byte("pdf body")
+	longName := strings.Repeat("a", 300)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+longName+`"`)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", "8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	res, err := Resolve(http.DefaultClient, srv.URL)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if res.Body != nil {
+		defer res.Body.Close()
+	}
+	if len(res.Filename) > maxFilenameLength {
+		t.Fatalf("filename is %d bytes after appending an extension, want at most %d", len(res.Filename), maxFilenameLength)
+	}
+	if !strings.HasSuffix(res.Filename, ".pdf") {
+		t.Fatalf("expected the appended extension to survive truncation, got %q", res.Filename)
+	}
+}
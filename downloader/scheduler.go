@@ -0,0 +1,332 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scheduler dispatches a manifest's blocks across a pool of workers. Idle
+// workers steal the unwritten tail of another worker's block instead of
+// sitting idle while a slow connection finishes the last one.
+type scheduler struct {
+	d        *Downloader
+	manifest *Manifest
+	file     *os.File
+	pool     *mirrorPool
+
+	mu       sync.Mutex
+	queue    []*Block
+	inflight map[*Block]*inflightFetch
+}
+
+// inflightFetch is what steal() has to work with for one block currently
+// being fetched: a way to cancel its request, and its owning worker's
+// bandwidthTracker, so a slow worker's tail can be prioritized over a fast
+// worker's even when the fast one happens to have more raw bytes left.
+type inflightFetch struct {
+	cancel context.CancelFunc
+	bw     *bandwidthTracker
+}
+
+func newScheduler(d *Downloader, manifest *Manifest, file *os.File, pool *mirrorPool) *scheduler {
+	s := &scheduler{
+		d:        d,
+		manifest: manifest,
+		file:     file,
+		pool:     pool,
+		inflight: make(map[*Block]*inflightFetch),
+	}
+
+	for _, b := range manifest.Blocks {
+		if !b.done() {
+			s.queue = append(s.queue, b)
+		}
+	}
+
+	return s
+}
+
+func (s *scheduler) run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, s.d.concurrency)
+
+	for i := 0; i < s.d.concurrency; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			s.work(ctx, workerID, errCh)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var firstErr error
+	for e := range errCh {
+		if e != nil && firstErr == nil {
+			firstErr = e
+		}
+	}
+
+	// Flush whatever progress was made even on error/cancellation, so a
+	// paused or interrupted download leaves a manifest behind to resume
+	// from instead of silently discarding it.
+	if ferr := s.d.flush(s.manifest); ferr != nil && firstErr == nil {
+		firstErr = ferr
+	}
+
+	return firstErr
+}
+
+// work pulls blocks off the shared queue until it runs dry, then tries to
+// steal the tail of whichever in-flight block has the most work left.
+func (s *scheduler) work(ctx context.Context, workerID int, errCh chan<- error) {
+	bw := newBandwidthTracker()
+
+	for {
+		if ctx.Err() != nil {
+			errCh <- ctx.Err()
+			return
+		}
+
+		blk := s.pop()
+		if blk == nil {
+			blk = s.steal()
+			if blk == nil {
+				return
+			}
+		}
+
+		if err := s.fetchBlock(ctx, blk, bw); err != nil {
+			errCh <- err
+			return
+		}
+	}
+}
+
+func (s *scheduler) pop() *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) == 0 {
+		return nil
+	}
+
+	blk := s.queue[len(s.queue)-1]
+	s.queue = s.queue[:len(s.queue)-1]
+	return blk
+}
+
+// stealMinFraction is the fraction of a full block's size a victim must
+// still have left before it's worth splitting in two; stealing a
+// near-finished block just trades one small request for two. Blocks start
+// at exactly BlockSize (or less, for the final partial block) and only
+// shrink as they're stolen from, so this must be a fraction of BlockSize,
+// not a multiple of it — a multiple could never be satisfied.
+const stealMinFraction = 0.5
+
+// steal picks the in-flight block estimated to take the longest to finish
+// (remaining bytes divided by its worker's demonstrated throughput, not
+// just raw remaining bytes, so a slow worker's tail is preferred over a
+// fast worker's even if the fast one happens to have more bytes left),
+// shrinks its End via CAS, cancels its current request so the owner
+// reissues one covering only its smaller share, and returns a new block
+// covering the stolen tail.
+func (s *scheduler) steal() *Block {
+	s.mu.Lock()
+	var victim *Block
+	var victimCancel context.CancelFunc
+	var mostRemaining int64
+	var worstETA float64 = -1
+
+	for b, f := range s.inflight {
+		r := b.remaining()
+		eta := estimatedSecondsRemaining(r, f.bw.bytesPerSec())
+		if eta > worstETA {
+			worstETA = eta
+			mostRemaining = r
+			victim = b
+			victimCancel = f.cancel
+		}
+	}
+	s.mu.Unlock()
+
+	stealThreshold := int64(float64(s.manifest.BlockSize) * stealMinFraction)
+	if victim == nil || mostRemaining < stealThreshold {
+		return nil
+	}
+
+	oldEnd := atomic.LoadInt64(&victim.End)
+	written := victim.Start + atomic.LoadInt64(&victim.Downloaded)
+	mid := written + (oldEnd-written)/2
+
+	if !atomic.CompareAndSwapInt64(&victim.End, oldEnd, mid) {
+		// Victim finished or was already stolen from since we read it.
+		return nil
+	}
+
+	// The victim's in-flight request was issued with the old (larger)
+	// range; cancel it so its owner notices the shrink and reissues a
+	// request for only its remaining share.
+	victimCancel()
+
+	stolen := &Block{Start: mid + 1, End: oldEnd}
+
+	// d.flush (called concurrently by in-flight fetches) reads
+	// s.manifest.Blocks under d.mu to snapshot it for save(); append
+	// through the same mutex rather than s.mu, which guards unrelated
+	// scheduler state, so the two never race on the slice header.
+	s.d.mu.Lock()
+	s.manifest.Blocks = append(s.manifest.Blocks, stolen)
+	s.d.mu.Unlock()
+
+	return stolen
+}
+
+// fetchBlock drives a block to completion, reissuing the request whenever
+// it's interrupted by a steal shrinking its range out from under it.
+func (s *scheduler) fetchBlock(ctx context.Context, blk *Block, bw *bandwidthTracker) error {
+	for !blk.done() {
+		reqCtx, cancel := context.WithCancel(ctx)
+
+		s.mu.Lock()
+		s.inflight[blk] = &inflightFetch{cancel: cancel, bw: bw}
+		s.mu.Unlock()
+
+		err := s.fetchOnce(reqCtx, blk, bw)
+
+		s.mu.Lock()
+		delete(s.inflight, blk)
+		s.mu.Unlock()
+		cancel()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if reqCtx.Err() != nil {
+				// Our own request was cancelled by a steal, not by the
+				// caller: the block's End shrank, so loop and reissue a
+				// request for what's left of it.
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchOnce fetches whatever is left of blk (as of the moment it's
+// called), dispatching to whichever mirror currently looks fastest. A
+// mirror that errors, returns a bad status, or truncates the body is
+// recorded as a failure and the remaining bytes are retried on a
+// different mirror, up to MaxRetries attempts in total.
+func (s *scheduler) fetchOnce(ctx context.Context, blk *Block, bw *bandwidthTracker) error {
+	var lastTried *mirror
+
+	for attempt := 1; attempt <= MaxRetries; attempt++ {
+		start := blk.Start + atomic.LoadInt64(&blk.Downloaded)
+		end := atomic.LoadInt64(&blk.End)
+		if start > end {
+			return nil
+		}
+
+		m := s.pool.pick(lastTried)
+		lastTried = m
+
+		n, err := s.fetchFromMirror(ctx, m, blk, start, end, bw)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		m.recordFailure()
+		if attempt < MaxRetries {
+			fmt.Printf("block [%d-%d]: %s failed after %d bytes: %v. Retrying on another mirror...\n", blk.Start, blk.End, m.url, n, err)
+			time.Sleep(time.Second * time.Duration(attempt))
+			continue
+		}
+		return fmt.Errorf("block [%d-%d]: failed after %d attempts, last error from %s: %v", blk.Start, blk.End, MaxRetries, m.url, err)
+	}
+
+	return nil
+}
+
+// fetchFromMirror issues a single Range request against m for [start,end]
+// and streams the response into the output file at the correct offset. It
+// returns the number of bytes written by this call even on error, so the
+// caller can log how much of the range was salvaged before the failure.
+func (s *scheduler) fetchFromMirror(ctx context.Context, m *mirror, blk *Block, start, end int64, bw *bandwidthTracker) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", m.url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create GET request: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	requestStart := time.Now()
+	resp, err := s.d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform GET request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("server returned status: %s", resp.Status)
+	}
+
+	offset := start
+	buf := make([]byte, 32*1024)
+	lastFlush := time.Now()
+	var sinceFlush int64
+
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := s.file.WriteAt(buf[:n], offset); werr != nil {
+				return offset - start, fmt.Errorf("failed to write at offset %d: %v", offset, werr)
+			}
+			offset += int64(n)
+			atomic.AddInt64(&blk.Downloaded, int64(n))
+			bw.add(n)
+			sinceFlush += int64(n)
+
+			if sinceFlush >= flushBytes || time.Since(lastFlush) >= flushInterval {
+				if ferr := s.d.flush(s.manifest); ferr != nil {
+					return offset - start, ferr
+				}
+				sinceFlush = 0
+				lastFlush = time.Now()
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			if ctx.Err() != nil {
+				return offset - start, ctx.Err()
+			}
+			return offset - start, fmt.Errorf("failed reading response body: %v", readErr)
+		}
+	}
+
+	written := offset - start
+	if want := end - start + 1; written != want {
+		return written, fmt.Errorf("truncated body: got %d bytes, wanted %d", written, want)
+	}
+
+	if elapsed := time.Since(requestStart).Seconds(); elapsed > 0 {
+		m.recordSuccess(float64(written) / elapsed)
+	}
+
+	return written, nil
+}
@@ -0,0 +1,226 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rangeServer serves body out of memory, honouring single-range requests
+// exactly like a real static file server would.
+func rangeServer(t *testing.T, body []byte, slowRange func(start int64) bool) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		if rangeHeader == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(body)
+			return
+		}
+
+		var start, end int64
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end > int64(len(body))-1 {
+			end = int64(len(body)) - 1
+		}
+
+		if slowRange != nil && slowRange(start) {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[start : end+1])
+	}))
+}
+
+func TestDownloaderRunBlocksReassemblesFile(t *testing.T) {
+	body := make([]byte, 5*1024*1024+777) // spans several blocks, last one partial
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate random body: %v", err)
+	}
+
+	srv := rangeServer(t, body, nil)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir, WithConcurrency(4), WithBlockSize(1<<20))
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	got, err := os.ReadFile(d.Dest())
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("downloaded file does not match source body (got %d bytes, want %d)", len(got), len(body))
+	}
+}
+
+func TestSchedulerStealSplitsAnInFlightBlock(t *testing.T) {
+	blockSize := int64(1 << 20)
+	manifest := &Manifest{BlockSize: blockSize, Blocks: []*Block{{Start: 0, End: blockSize - 1}}}
+	blk := manifest.Blocks[0]
+
+	d := &Downloader{}
+	s := newScheduler(d, manifest, nil, nil)
+
+	_, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.inflight[blk] = &inflightFetch{cancel: cancel, bw: newBandwidthTracker()}
+
+	stolen := s.steal()
+	if stolen == nil {
+		t.Fatal("expected steal to split a fresh, untouched in-flight block, got nil")
+	}
+	if len(manifest.Blocks) != 2 {
+		t.Fatalf("got %d blocks after steal, want 2", len(manifest.Blocks))
+	}
+	if manifest.Blocks[1] != stolen {
+		t.Fatal("expected the stolen block to have been appended to manifest.Blocks")
+	}
+	if stolen.Start <= blk.Start || stolen.End != blockSize-1 {
+		t.Fatalf("stolen block [%d-%d] does not look like the victim's shrunk-away tail", stolen.Start, stolen.End)
+	}
+	if got := blk.End; got >= blockSize-1 {
+		t.Fatalf("victim's End was not shrunk by the steal, got %d", got)
+	}
+}
+
+func TestDownloaderWorkStealingSurvivesAThrottledBlock(t *testing.T) {
+	body := make([]byte, 4*1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate random body: %v", err)
+	}
+
+	// Throttle the very first block so an idle worker should steal the
+	// back half of it rather than wait the download out.
+	srv := rangeServer(t, body, func(start int64) bool { return start == 0 })
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir, WithConcurrency(4), WithBlockSize(1<<20))
+
+	done := make(chan error, 1)
+	go func() { done <- d.Start(context.Background()) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download did not complete in time; slow block likely wasn't stolen")
+	}
+
+	got, err := os.ReadFile(d.Dest())
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("downloaded file does not match source body")
+	}
+}
+
+func TestDownloaderPauseMidDownloadLeavesResumableState(t *testing.T) {
+	body := make([]byte, 4*1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatalf("failed to generate random body: %v", err)
+	}
+
+	// Slow down every real block request, but answer the bytes=0-0 probe
+	// Resolve issues instantly so Pause lands during the actual download,
+	// not while Start is still resolving the resource.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		var start, end int64
+		if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end > int64(len(body))-1 {
+			end = int64(len(body)) - 1
+		}
+		if !(start == 0 && end == 0) {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(body[start : end+1])
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir, WithConcurrency(2), WithBlockSize(1<<20))
+
+	done := make(chan error, 1)
+	go func() { done <- d.Start(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	d.Pause()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Start should report a clean pause, not an error: %v", err)
+	}
+	if d.Status() != StatusPaused {
+		t.Fatalf("got status %s, want %s", d.Status(), StatusPaused)
+	}
+
+	got, err := os.ReadFile(d.Dest())
+	if err != nil {
+		t.Fatalf("failed to read partial file: %v", err)
+	}
+	if bytes.Equal(got, body) {
+		t.Fatal("expected the paused download to be incomplete, but it matches the full source body")
+	}
+
+	if _, err := os.Stat(d.Dest() + ".meta.json"); err != nil {
+		t.Fatalf("expected a manifest to remain so the download can resume, got: %v", err)
+	}
+}
+
+func TestDownloaderFallsBackToSingleStream(t *testing.T) {
+	body := []byte(strings.Repeat("x", 1024))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ignore Range entirely and don't advertise support for it either.
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir)
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	got, err := os.ReadFile(d.Dest())
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatal("downloaded file does not match source body")
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.Base(d.Dest())+".meta.json")); !os.IsNotExist(err) {
+		t.Fatal("expected manifest to be cleaned up after a successful download")
+	}
+}
@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/mujsann/file-downloader/verify"
+)
+
+func TestDownloaderChecksumMismatchFailsAndDeletesFile(t *testing.T) {
+	body := []byte(strings.Repeat("x", 1024))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir, WithChecksum(strings.Repeat("0", 64)))
+
+	err := d.Start(context.Background())
+	if err == nil {
+		t.Fatal("expected Start to fail on checksum mismatch")
+	}
+	if !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected a checksum error, got: %v", err)
+	}
+	if d.Status() != StatusError {
+		t.Fatalf("expected StatusError, got %s", d.Status())
+	}
+	if _, err := os.Stat(d.Dest()); !os.IsNotExist(err) {
+		t.Fatal("expected the downloaded file to be deleted after a checksum mismatch")
+	}
+}
+
+func TestDownloaderChecksumMatchSucceeds(t *testing.T) {
+	body := []byte(strings.Repeat("y", 2048))
+	sum := sha256.Sum256(body)
+	want := hex.EncodeToString(sum[:])
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	d := New(srv.URL, dir, WithChecksum(want))
+
+	if err := d.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if _, err := os.Stat(d.Dest()); err != nil {
+		t.Fatalf("expected the downloaded file to remain on a checksum match: %v", err)
+	}
+}
+
+type stubScanner struct {
+	result verify.Result
+}
+
+func (s stubScanner) Scan(ctx context.Context, path string) (verify.Result, error) {
+	return s.result, nil
+}
+
+func TestDownloaderScanStrictDeletesFileOnDirtyVerdict(t *testing.T) {
+	body := []byte("payload")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dirty := stubScanner{result: verify.Result{Clean: false, Message: "eicar test signature"}}
+	d := New(srv.URL, dir, WithScanner(dirty, true))
+
+	err := d.Start(context.Background())
+	if err == nil {
+		t.Fatal("expected Start to fail when -scan-strict rejects the file")
+	}
+	if _, err := os.Stat(d.Dest()); !os.IsNotExist(err) {
+		t.Fatal("expected the downloaded file to be deleted after a strict scan failure")
+	}
+}
@@ -0,0 +1,90 @@
+// Package verify implements post-download integrity checks: checksum
+// verification and an optional pluggable antivirus scan.
+package verify
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sha256File streams path through a sha256 hash and returns its hex
+// digest, without holding the whole file in memory.
+func Sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %v", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyChecksum computes path's sha256 digest and compares it against
+// want (case-insensitive hex), returning an error on mismatch.
+func VerifyChecksum(path, want string) error {
+	got, err := Sha256File(path)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("checksum mismatch: got %s, want %s", got, want)
+	}
+
+	return nil
+}
+
+// FetchChecksumFor downloads a `sha256sum`-format file from checksumURL
+// (lines of "<hex>  <filename>") and returns the digest for filename.
+func FetchChecksumFor(client *http.Client, checksumURL, filename string) (string, error) {
+	resp, err := client.Get(checksumURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksum file: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checksum file request returned status: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var onlyHash string
+	entries := 0
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		entries++
+
+		hash, name := fields[0], strings.TrimPrefix(fields[1], "*")
+		onlyHash = hash
+		if filepath.Base(name) == filename {
+			return hash, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %v", err)
+	}
+
+	if entries == 1 {
+		// Single-entry checksum files often don't repeat the exact
+		// destination filename; fall back to the only hash present.
+		return onlyHash, nil
+	}
+
+	return "", fmt.Errorf("no checksum found for %s in %s", filename, checksumURL)
+}
@@ -0,0 +1,55 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	sum := sha256.Sum256([]byte("hello world"))
+	want := hex.EncodeToString(sum[:])
+
+	if err := VerifyChecksum(path, want); err != nil {
+		t.Fatalf("expected matching checksum to verify, got: %v", err)
+	}
+	// Case-insensitive comparison.
+	if err := VerifyChecksum(path, strings.ToUpper(want)); err != nil {
+		t.Fatalf("expected an uppercase-hex checksum to verify, got: %v", err)
+	}
+	if err := VerifyChecksum(path, strings.Repeat("0", 64)); err == nil {
+		t.Fatal("expected a mismatching checksum to fail")
+	}
+}
+
+func TestFetchChecksumFor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("deadbeef00112233445566778899aabbccddeeff00112233445566778899aa  file.bin\n" +
+			"cafebabe00112233445566778899aabbccddeeff00112233445566778899aa  other.bin\n"))
+	}))
+	defer srv.Close()
+
+	got, err := FetchChecksumFor(http.DefaultClient, srv.URL, "file.bin")
+	if err != nil {
+		t.Fatalf("FetchChecksumFor failed: %v", err)
+	}
+	want := "deadbeef00112233445566778899aabbccddeeff00112233445566778899aa"
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+
+	if _, err := FetchChecksumFor(http.DefaultClient, srv.URL, "missing.bin"); err == nil {
+		t.Fatal("expected an error for a filename absent from the checksum file")
+	}
+}
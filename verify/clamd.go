@@ -0,0 +1,82 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// clamdChunkSize is how much of the file is sent per INSTREAM chunk.
+const clamdChunkSize = 64 * 1024
+
+// ClamdScanner scans a file by streaming it to a clamd daemon's INSTREAM
+// command over TCP, so the file never needs to be readable by the clamd
+// process itself.
+type ClamdScanner struct {
+	// Addr is the clamd TCP address, e.g. "localhost:3310".
+	Addr string
+}
+
+// Scan streams path to clamd and reports whether it came back clean.
+func (c ClamdScanner) Scan(ctx context.Context, path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to dial clamd at %s: %v", c.Addr, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\000")); err != nil {
+		return Result{}, fmt.Errorf("failed to send INSTREAM command: %v", err)
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, readErr := f.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return Result{}, fmt.Errorf("failed to write chunk size: %v", err)
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return Result{}, fmt.Errorf("failed to write chunk: %v", err)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return Result{}, fmt.Errorf("failed reading %s: %v", path, readErr)
+		}
+	}
+
+	// A zero-length chunk tells clamd the stream is done.
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return Result{}, fmt.Errorf("failed to write end-of-stream marker: %v", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\000')
+	if err != nil && reply == "" {
+		return Result{}, fmt.Errorf("failed to read clamd response: %v", err)
+	}
+	reply = strings.TrimRight(reply, "\000\r\n")
+
+	if strings.HasSuffix(reply, "OK") {
+		return Result{Clean: true, Message: reply}, nil
+	}
+
+	return Result{Clean: false, Message: reply}, nil
+}
@@ -0,0 +1,94 @@
+package verify
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeClamd accepts a single INSTREAM session, reads chunks until the
+// zero-length terminator, and replies with reply.
+func fakeClamd(t *testing.T, reply string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start fake clamd listener: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		// Consume the zINSTREAM\0 command.
+		if _, err := r.ReadString('\000'); err != nil {
+			return
+		}
+
+		size := make([]byte, 4)
+		for {
+			if _, err := r.Read(size); err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+				return
+			}
+		}
+
+		conn.Write([]byte(reply + "\000"))
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestClamdScannerReportsCleanResult(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	addr := fakeClamd(t, "stream: OK")
+	scanner := ClamdScanner{Addr: addr}
+
+	result, err := scanner.Scan(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if !result.Clean {
+		t.Fatalf("expected a clean result, got %+v", result)
+	}
+}
+
+func TestClamdScannerReportsInfectedResult(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+
+	addr := fakeClamd(t, "stream: Eicar-Test-Signature FOUND")
+	scanner := ClamdScanner{Addr: addr}
+
+	result, err := scanner.Scan(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.Clean {
+		t.Fatalf("expected a non-clean result, got %+v", result)
+	}
+}
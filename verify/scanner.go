@@ -0,0 +1,14 @@
+package verify
+
+import "context"
+
+// Result is a scanner's verdict on a file.
+type Result struct {
+	Clean   bool
+	Message string
+}
+
+// Scanner checks a file on disk for malware.
+type Scanner interface {
+	Scan(ctx context.Context, path string) (Result, error)
+}
@@ -0,0 +1,78 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// virusTotalLookupURL is VirusTotal's file-report-by-hash endpoint. Only
+// the file's hash is sent, never its contents.
+const virusTotalLookupURL = "https://www.virustotal.com/api/v3/files/"
+
+// VirusTotalScanner looks up a file's sha256 hash against VirusTotal's
+// public database of previously-scanned files. It never uploads the file
+// itself, so it only has a verdict for hashes VirusTotal has already seen.
+type VirusTotalScanner struct {
+	APIKey string
+	Client *http.Client
+}
+
+type virusTotalResponse struct {
+	Data struct {
+		Attributes struct {
+			LastAnalysisStats struct {
+				Malicious  int `json:"malicious"`
+				Suspicious int `json:"suspicious"`
+			} `json:"last_analysis_stats"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Scan hashes path and looks that hash up on VirusTotal.
+func (v VirusTotalScanner) Scan(ctx context.Context, path string) (Result, error) {
+	hash, err := Sha256File(path)
+	if err != nil {
+		return Result{}, err
+	}
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", virusTotalLookupURL+hash, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create VirusTotal request: %v", err)
+	}
+	req.Header.Set("x-apikey", v.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to query VirusTotal: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Result{Clean: true, Message: "hash not previously seen by VirusTotal"}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("VirusTotal returned status: %s", resp.Status)
+	}
+
+	var parsed virusTotalResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return Result{}, fmt.Errorf("failed to parse VirusTotal response: %v", err)
+	}
+
+	stats := parsed.Data.Attributes.LastAnalysisStats
+	if stats.Malicious > 0 || stats.Suspicious > 0 {
+		return Result{
+			Clean:   false,
+			Message: fmt.Sprintf("%d engines flagged this file as malicious, %d as suspicious", stats.Malicious, stats.Suspicious),
+		}, nil
+	}
+
+	return Result{Clean: true, Message: "no engines flagged this file"}, nil
+}